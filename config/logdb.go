@@ -0,0 +1,26 @@
+// Copyright 2017-2019 Lei Ni (nilei81@gmail.com) and other Dragonboat authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+// LogDBConfig carries the tunable settings used by logdb's kv store
+// backends.
+type LogDBConfig struct {
+	// KVStoreType is the name of the kv store factory, as registered with
+	// logdb.RegisterKVStoreFactory, to use for the Raft log store. When
+	// empty, logdb.DefaultKVStoreTypeName is used. This lets a NodeHost
+	// pick between the backends compiled into the binary (e.g. "pebble",
+	// "badger") at runtime rather than via build tags.
+	KVStoreType string
+}
@@ -0,0 +1,380 @@
+// Copyright 2017-2019 Lei Ni (nilei81@gmail.com) and other Dragonboat authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package badger implements the IKVStore interface defined in the kv
+// package using BadgerDB (github.com/dgraph-io/badger/v4) as the backing
+// key-value store.
+package badger
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"github.com/lni/dragonboat/v3/config"
+	"github.com/lni/dragonboat/v3/internal/logdb/kv"
+	"github.com/lni/dragonboat/v3/internal/vfs"
+	"github.com/lni/dragonboat/v3/logger"
+	"github.com/lni/dragonboat/v3/raftio"
+)
+
+var plog = logger.GetLogger("badgerkv")
+
+// deleteEntryOverhead approximates the per-entry bookkeeping cost Badger
+// charges a delete marker in addition to its key, used to stay under
+// MaxBatchSize with some safety margin.
+const deleteEntryOverhead = 32
+
+// compactionInterval controls how many Compaction calls for a sub range
+// accumulate before a real reclaim pass is triggered. Badger has no notion
+// of range local compaction, so per-call sub ranges (the only kind rdb
+// actually issues, one per cluster/node on every snapshot/log truncation)
+// are merged into a single, infrequent, whole-keyspace Flatten rather than
+// being dropped forever or logged on every call.
+const compactionInterval = 128
+
+// KVStore is a BadgerDB backed implementation of kv.IKVStore.
+type KVStore struct {
+	mu              sync.RWMutex
+	db              *badger.DB
+	closed          bool
+	compactionCalls uint64
+}
+
+var _ kv.IKVStore = (*KVStore)(nil)
+
+// NewKVStore creates a badger backed kv store persisted in the specified
+// directory. The wal directory, when different from dir, is used as
+// Badger's ValueDir.
+func NewKVStore(config config.LogDBConfig,
+	dir string, wal string, fs vfs.IFS) (kv.IKVStore, error) {
+	if fs == nil {
+		panic("nil fs")
+	}
+	opts := badger.DefaultOptions(dir)
+	if len(wal) > 0 {
+		opts = opts.WithValueDir(wal)
+	}
+	opts = opts.WithLogger(nil)
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &KVStore{db: db}, nil
+}
+
+func (r *KVStore) checkClosed() error {
+	if r.closed {
+		return badger.ErrDBClosed
+	}
+	return nil
+}
+
+// Close closes the kv store, it is idempotent and safe to call more than
+// once.
+func (r *KVStore) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	return r.db.Close()
+}
+
+// GetWriteBatch returns a new write batch instance. Badger's WriteBatch
+// can not be pooled through raftio.IContext the way pebble's can, so a
+// fresh one is always returned here.
+func (r *KVStore) GetWriteBatch(ctx raftio.IContext) kv.IWriteBatch {
+	return &writeBatch{}
+}
+
+// SaveValue puts the specified key/value pair into the kv store directly,
+// not going through a write batch.
+func (r *KVStore) SaveValue(key []byte, value []byte) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if err := r.checkClosed(); err != nil {
+		return err
+	}
+	return r.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(copyBytes(key), copyBytes(value))
+	})
+}
+
+// DeleteValue deletes the specified key from the kv store.
+func (r *KVStore) DeleteValue(key []byte) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if err := r.checkClosed(); err != nil {
+		return err
+	}
+	return r.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(key)
+	})
+}
+
+// GetValue invokes the op function with the value associated with the
+// specified key. op is invoked with a nil slice when the key does not
+// exist.
+func (r *KVStore) GetValue(key []byte, op func([]byte) error) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if err := r.checkClosed(); err != nil {
+		return err
+	}
+	return r.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err == badger.ErrKeyNotFound {
+			return op(nil)
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return op(val)
+		})
+	})
+}
+
+// IterateValue iterates over the [fk, lk] key range, invoking op for every
+// visited key/value pair. lk is included in the range when inc is true.
+// Badger's iterator is seek based rather than bounded, so the upper bound
+// is enforced explicitly on every step.
+func (r *KVStore) IterateValue(fk []byte, lk []byte,
+	inc bool, op func(key []byte, data []byte) (bool, error)) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if err := r.checkClosed(); err != nil {
+		return err
+	}
+	return r.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Seek(fk); it.Valid(); it.Next() {
+			item := it.Item()
+			key := item.KeyCopy(nil)
+			cmp := bytes.Compare(key, lk)
+			if cmp > 0 || (cmp == 0 && !inc) {
+				return nil
+			}
+			val, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			cont, err := op(key, val)
+			if err != nil {
+				return err
+			}
+			if !cont {
+				return nil
+			}
+		}
+		return nil
+	})
+}
+
+// CommitWriteBatch commits the specified write batch.
+func (r *KVStore) CommitWriteBatch(wb kv.IWriteBatch) error {
+	return r.commit(wb)
+}
+
+// CommitDeleteBatch commits the specified write batch that is expected to
+// mostly, or entirely, consist of delete operations.
+func (r *KVStore) CommitDeleteBatch(wb kv.IWriteBatch) error {
+	return r.commit(wb)
+}
+
+func (r *KVStore) commit(iwb kv.IWriteBatch) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if err := r.checkClosed(); err != nil {
+		return err
+	}
+	wb, ok := iwb.(*writeBatch)
+	if !ok {
+		panic("unknown write batch type")
+	}
+	if len(wb.puts) > 0 {
+		bwb := r.db.NewWriteBatch()
+		defer bwb.Cancel()
+		for _, kv := range wb.puts {
+			if err := bwb.Set(kv.key, kv.value); err != nil {
+				return err
+			}
+		}
+		if err := bwb.Flush(); err != nil {
+			return err
+		}
+	}
+	if len(wb.deletes) > 0 {
+		// Badger's WriteBatch can not be mixed with reads and offers no
+		// ordering guarantees across concurrent batches, so deletes are
+		// applied through a managed read-write transaction instead.
+		if err := deleteInChunks(r.db, wb.deletes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveEntries removes all entries in the [fk, lk] range.
+func (r *KVStore) RemoveEntries(fk []byte, lk []byte) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if err := r.checkClosed(); err != nil {
+		return err
+	}
+	keys, err := r.collectRange(fk, lk)
+	if err != nil {
+		return err
+	}
+	return deleteInChunks(r.db, keys)
+}
+
+// deleteChunkSize returns how many keys can be removed within a single
+// managed transaction without risking badger.ErrTxnTooBig, derived from the
+// db's live MaxBatchCount/MaxBatchSize limits rather than a hardcoded
+// guess, so it keeps holding if those options are ever tightened.
+func deleteChunkSize(db *badger.DB, keys [][]byte) int {
+	maxKeyLen := 0
+	for _, key := range keys {
+		if len(key) > maxKeyLen {
+			maxKeyLen = len(key)
+		}
+	}
+	n := db.MaxBatchCount()
+	if bySize := db.MaxBatchSize() / int64(maxKeyLen+deleteEntryOverhead); bySize < n {
+		n = bySize
+	}
+	if n < 1 {
+		n = 1
+	}
+	return int(n)
+}
+
+// deleteInChunks removes the given keys through one or more managed
+// read-write transactions, each sized by deleteChunkSize.
+func deleteInChunks(db *badger.DB, keys [][]byte) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	chunkSize := deleteChunkSize(db, keys)
+	for start := 0; start < len(keys); start += chunkSize {
+		end := start + chunkSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		chunk := keys[start:end]
+		if err := db.Update(func(txn *badger.Txn) error {
+			for _, key := range chunk {
+				if err := txn.Delete(key); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *KVStore) collectRange(fk []byte, lk []byte) ([][]byte, error) {
+	keys := make([][]byte, 0)
+	err := r.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Seek(fk); it.Valid(); it.Next() {
+			key := it.Item().KeyCopy(nil)
+			if bytes.Compare(key, lk) > 0 {
+				return nil
+			}
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	return keys, err
+}
+
+// Compaction reclaims space held by deleted/overwritten versions of the
+// keys in the [fk, lk] range. Badger has no notion of range local
+// compaction, so a full range request flattens immediately while sub range
+// requests (the ones actually issued by rdb) are accumulated and merged
+// into an occasional whole-keyspace Flatten, see compactionInterval.
+func (r *KVStore) Compaction(fk []byte, lk []byte) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if err := r.checkClosed(); err != nil {
+		return err
+	}
+	if len(fk) == 0 && len(lk) == 0 {
+		return r.db.Flatten(1)
+	}
+	if n := atomic.AddUint64(&r.compactionCalls, 1); n%compactionInterval != 0 {
+		return nil
+	}
+	plog.Debugf("flattening badger db after %d accumulated sub range compaction requests",
+		compactionInterval)
+	return r.db.Flatten(1)
+}
+
+type kvPair struct {
+	key   []byte
+	value []byte
+}
+
+// writeBatch accumulates Put/Delete operations. Puts are committed using
+// badger.WriteBatch while deletes are committed using a managed
+// transaction, as badger.WriteBatch does not support ordered iteration and
+// can not be mixed with reads.
+type writeBatch struct {
+	puts    []kvPair
+	deletes [][]byte
+}
+
+var _ kv.IWriteBatch = (*writeBatch)(nil)
+
+func (wb *writeBatch) Put(key []byte, value []byte) {
+	wb.puts = append(wb.puts, kvPair{key: copyBytes(key), value: copyBytes(value)})
+}
+
+func (wb *writeBatch) Delete(key []byte) {
+	wb.deletes = append(wb.deletes, copyBytes(key))
+}
+
+func (wb *writeBatch) Count() int {
+	return len(wb.puts) + len(wb.deletes)
+}
+
+func (wb *writeBatch) Clear() {
+	wb.puts = wb.puts[:0]
+	wb.deletes = wb.deletes[:0]
+}
+
+func (wb *writeBatch) Destroy() {
+	wb.puts = nil
+	wb.deletes = nil
+}
+
+func copyBytes(v []byte) []byte {
+	if v == nil {
+		return nil
+	}
+	r := make([]byte, len(v))
+	copy(r, v)
+	return r
+}
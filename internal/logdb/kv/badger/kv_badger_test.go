@@ -0,0 +1,261 @@
+// Copyright 2017-2019 Lei Ni (nilei81@gmail.com) and other Dragonboat authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package badger
+
+import (
+	"testing"
+
+	"github.com/lni/dragonboat/v3/config"
+	"github.com/lni/dragonboat/v3/internal/logdb/kv"
+	"github.com/lni/dragonboat/v3/internal/vfs"
+)
+
+func getTestKVStore(t *testing.T) kv.IKVStore {
+	dir := t.TempDir()
+	store, err := NewKVStore(config.LogDBConfig{}, dir, dir, vfs.GetTestFS())
+	if err != nil {
+		t.Fatalf("failed to create badger kv store %v", err)
+	}
+	return store
+}
+
+func runKVStoreTest(t *testing.T, tf func(t *testing.T, s kv.IKVStore)) {
+	s := getTestKVStore(t)
+	defer func() {
+		if err := s.Close(); err != nil {
+			t.Fatalf("failed to close kv store %v", err)
+		}
+	}()
+	tf(t, s)
+}
+
+func TestSaveAndGetValue(t *testing.T) {
+	runKVStoreTest(t, func(t *testing.T, s kv.IKVStore) {
+		if err := s.SaveValue([]byte("k1"), []byte("v1")); err != nil {
+			t.Fatalf("save value failed %v", err)
+		}
+		var got []byte
+		if err := s.GetValue([]byte("k1"), func(v []byte) error {
+			got = append([]byte{}, v...)
+			return nil
+		}); err != nil {
+			t.Fatalf("get value failed %v", err)
+		}
+		if string(got) != "v1" {
+			t.Fatalf("unexpected value %s", got)
+		}
+	})
+}
+
+func TestGetValueOnMissingKeyReturnsNil(t *testing.T) {
+	runKVStoreTest(t, func(t *testing.T, s kv.IKVStore) {
+		seen := false
+		if err := s.GetValue([]byte("missing"), func(v []byte) error {
+			seen = true
+			if v != nil {
+				t.Fatalf("expected nil value, got %v", v)
+			}
+			return nil
+		}); err != nil {
+			t.Fatalf("get value failed %v", err)
+		}
+		if !seen {
+			t.Fatalf("op not invoked")
+		}
+	})
+}
+
+func TestDeleteValue(t *testing.T) {
+	runKVStoreTest(t, func(t *testing.T, s kv.IKVStore) {
+		if err := s.SaveValue([]byte("k1"), []byte("v1")); err != nil {
+			t.Fatalf("save value failed %v", err)
+		}
+		if err := s.DeleteValue([]byte("k1")); err != nil {
+			t.Fatalf("delete value failed %v", err)
+		}
+		if err := s.GetValue([]byte("k1"), func(v []byte) error {
+			if v != nil {
+				t.Fatalf("key not deleted")
+			}
+			return nil
+		}); err != nil {
+			t.Fatalf("get value failed %v", err)
+		}
+	})
+}
+
+func TestWriteBatchPutAndCommit(t *testing.T) {
+	runKVStoreTest(t, func(t *testing.T, s kv.IKVStore) {
+		wb := s.GetWriteBatch(nil)
+		defer wb.Destroy()
+		wb.Put([]byte("k1"), []byte("v1"))
+		wb.Put([]byte("k2"), []byte("v2"))
+		if wb.Count() != 2 {
+			t.Fatalf("unexpected count %d", wb.Count())
+		}
+		if err := s.CommitWriteBatch(wb); err != nil {
+			t.Fatalf("commit write batch failed %v", err)
+		}
+		if err := s.GetValue([]byte("k2"), func(v []byte) error {
+			if string(v) != "v2" {
+				t.Fatalf("unexpected value %s", v)
+			}
+			return nil
+		}); err != nil {
+			t.Fatalf("get value failed %v", err)
+		}
+	})
+}
+
+func TestWriteBatchDeleteAndCommitDeleteBatch(t *testing.T) {
+	runKVStoreTest(t, func(t *testing.T, s kv.IKVStore) {
+		if err := s.SaveValue([]byte("k1"), []byte("v1")); err != nil {
+			t.Fatalf("save value failed %v", err)
+		}
+		wb := s.GetWriteBatch(nil)
+		defer wb.Destroy()
+		wb.Delete([]byte("k1"))
+		if err := s.CommitDeleteBatch(wb); err != nil {
+			t.Fatalf("commit delete batch failed %v", err)
+		}
+		if err := s.GetValue([]byte("k1"), func(v []byte) error {
+			if v != nil {
+				t.Fatalf("key not deleted")
+			}
+			return nil
+		}); err != nil {
+			t.Fatalf("get value failed %v", err)
+		}
+	})
+}
+
+func TestIterateValueIsInclusiveOfBothEnds(t *testing.T) {
+	runKVStoreTest(t, func(t *testing.T, s kv.IKVStore) {
+		for i, k := range []string{"k1", "k2", "k3", "k4"} {
+			if err := s.SaveValue([]byte(k), []byte{byte(i)}); err != nil {
+				t.Fatalf("save value failed %v", err)
+			}
+		}
+		visited := make([]string, 0)
+		if err := s.IterateValue([]byte("k2"), []byte("k3"), true,
+			func(key []byte, data []byte) (bool, error) {
+				visited = append(visited, string(key))
+				return true, nil
+			}); err != nil {
+			t.Fatalf("iterate value failed %v", err)
+		}
+		if len(visited) != 2 || visited[0] != "k2" || visited[1] != "k3" {
+			t.Fatalf("unexpected range visited %v", visited)
+		}
+	})
+}
+
+func TestIterateValueCanStopEarly(t *testing.T) {
+	runKVStoreTest(t, func(t *testing.T, s kv.IKVStore) {
+		for i, k := range []string{"k1", "k2", "k3"} {
+			if err := s.SaveValue([]byte(k), []byte{byte(i)}); err != nil {
+				t.Fatalf("save value failed %v", err)
+			}
+		}
+		visited := 0
+		if err := s.IterateValue([]byte("k1"), []byte("k3"), true,
+			func(key []byte, data []byte) (bool, error) {
+				visited++
+				return false, nil
+			}); err != nil {
+			t.Fatalf("iterate value failed %v", err)
+		}
+		if visited != 1 {
+			t.Fatalf("expected iteration to stop after first entry, got %d", visited)
+		}
+	})
+}
+
+func TestRemoveEntriesRemovesTheWholeRange(t *testing.T) {
+	runKVStoreTest(t, func(t *testing.T, s kv.IKVStore) {
+		for i, k := range []string{"k1", "k2", "k3", "k4"} {
+			if err := s.SaveValue([]byte(k), []byte{byte(i)}); err != nil {
+				t.Fatalf("save value failed %v", err)
+			}
+		}
+		if err := s.RemoveEntries([]byte("k2"), []byte("k3")); err != nil {
+			t.Fatalf("remove entries failed %v", err)
+		}
+		remaining := make([]string, 0)
+		if err := s.IterateValue([]byte("k1"), []byte("k4"), true,
+			func(key []byte, data []byte) (bool, error) {
+				remaining = append(remaining, string(key))
+				return true, nil
+			}); err != nil {
+			t.Fatalf("iterate value failed %v", err)
+		}
+		if len(remaining) != 2 || remaining[0] != "k1" || remaining[1] != "k4" {
+			t.Fatalf("unexpected remaining keys %v", remaining)
+		}
+	})
+}
+
+func TestCompactionOnFullRangeDoesNotError(t *testing.T) {
+	runKVStoreTest(t, func(t *testing.T, s kv.IKVStore) {
+		if err := s.SaveValue([]byte("k1"), []byte("v1")); err != nil {
+			t.Fatalf("save value failed %v", err)
+		}
+		if err := s.Compaction(nil, nil); err != nil {
+			t.Fatalf("compaction failed %v", err)
+		}
+	})
+}
+
+func TestCompactionOnSubRangeThrottlesReclaim(t *testing.T) {
+	runKVStoreTest(t, func(t *testing.T, s kv.IKVStore) {
+		store := s.(*KVStore)
+		for i := 0; i < compactionInterval-1; i++ {
+			if err := s.Compaction([]byte("k1"), []byte("k2")); err != nil {
+				t.Fatalf("compaction failed %v", err)
+			}
+		}
+		if store.compactionCalls != compactionInterval-1 {
+			t.Fatalf("unexpected compaction call count %d", store.compactionCalls)
+		}
+		// the compactionInterval-th call crosses the threshold and runs a
+		// real Flatten, which must complete without error.
+		if err := s.Compaction([]byte("k1"), []byte("k2")); err != nil {
+			t.Fatalf("compaction failed %v", err)
+		}
+		if store.compactionCalls != compactionInterval {
+			t.Fatalf("unexpected compaction call count %d", store.compactionCalls)
+		}
+	})
+}
+
+func TestCloseIsIdempotent(t *testing.T) {
+	s := getTestKVStore(t)
+	if err := s.Close(); err != nil {
+		t.Fatalf("close failed %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("second close failed %v", err)
+	}
+}
+
+func TestOperationsFailAfterClose(t *testing.T) {
+	s := getTestKVStore(t)
+	if err := s.Close(); err != nil {
+		t.Fatalf("close failed %v", err)
+	}
+	if err := s.SaveValue([]byte("k1"), []byte("v1")); err == nil {
+		t.Fatalf("expected save value to fail after close")
+	}
+}
@@ -41,3 +41,7 @@ func newDefaultKVStore(config config.LogDBConfig,
 	}
 	return pebble.NewKVStore(config, dir, wal, fs)
 }
+
+func init() {
+	RegisterKVStoreFactory(DefaultKVStoreTypeName, newDefaultKVStore)
+}
@@ -0,0 +1,84 @@
+// Copyright 2017-2019 Lei Ni (nilei81@gmail.com) and other Dragonboat authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logdb
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/lni/dragonboat/v3/config"
+	"github.com/lni/dragonboat/v3/internal/logdb/kv"
+	"github.com/lni/dragonboat/v3/internal/vfs"
+)
+
+// KVStoreFactory creates a new kv.IKVStore instance for a specific storage
+// engine. dir and wal are the store's data and write-ahead-log directories.
+type KVStoreFactory func(config config.LogDBConfig,
+	dir string, wal string, fs vfs.IFS) (kv.IKVStore, error)
+
+type kvStoreRegistration struct {
+	factory KVStoreFactory
+	// forceBatchedEntries is set by backends that can not efficiently
+	// support the range scans over the raft log used by the plain
+	// entryManager, e.g.
+	// because the underlying store has no notion of ordered iteration.
+	forceBatchedEntries bool
+}
+
+var (
+	kvStoreRegistryMu sync.Mutex
+	kvStoreRegistry   = make(map[string]kvStoreRegistration)
+)
+
+// RegisterKVStoreFactory registers a named kv store factory so it can be
+// selected at runtime via config.LogDBConfig.KVStoreType, without having to
+// fork Dragonboat or select a backend through build tags. It is meant to be
+// called from the backend package's init() function. Registering the same
+// name twice is a programming error and panics.
+func RegisterKVStoreFactory(name string, factory KVStoreFactory) {
+	registerKVStoreFactory(name, factory, false)
+}
+
+// RegisterBatchedKVStoreFactory is identical to RegisterKVStoreFactory
+// except it also advertises that rdb must always use the batched
+// entryManager with this backend, regardless of what the caller asked for,
+// because the backend does not support efficient range scans over the raft
+// log.
+func RegisterBatchedKVStoreFactory(name string, factory KVStoreFactory) {
+	registerKVStoreFactory(name, factory, true)
+}
+
+func registerKVStoreFactory(name string,
+	factory KVStoreFactory, forceBatchedEntries bool) {
+	if len(name) == 0 {
+		panic("empty kv store factory name")
+	}
+	kvStoreRegistryMu.Lock()
+	defer kvStoreRegistryMu.Unlock()
+	if _, ok := kvStoreRegistry[name]; ok {
+		panic(fmt.Sprintf("kv store factory %q already registered", name))
+	}
+	kvStoreRegistry[name] = kvStoreRegistration{
+		factory:             factory,
+		forceBatchedEntries: forceBatchedEntries,
+	}
+}
+
+func getKVStoreFactory(name string) (kvStoreRegistration, bool) {
+	kvStoreRegistryMu.Lock()
+	defer kvStoreRegistryMu.Unlock()
+	reg, ok := kvStoreRegistry[name]
+	return reg, ok
+}
@@ -16,11 +16,15 @@ package logdb
 
 import (
 	"encoding/binary"
+	"fmt"
 	"math"
 
 	"github.com/lni/dragonboat/internal/settings"
 	"github.com/lni/dragonboat/raftio"
 	pb "github.com/lni/dragonboat/raftpb"
+	"github.com/lni/dragonboat/v3/config"
+	"github.com/lni/dragonboat/v3/internal/logdb/kv"
+	"github.com/lni/dragonboat/v3/internal/vfs"
 )
 
 var (
@@ -29,7 +33,7 @@ var (
 
 type entryManager interface {
 	binaryFormat() uint32
-	record(wb IWriteBatch,
+	record(wb kv.IWriteBatch,
 		clusterID uint64, nodeID uint64,
 		ctx raftio.IContext, entries []pb.Entry) uint64
 	iterate(ents []pb.Entry, maxIndex uint64,
@@ -42,23 +46,37 @@ type entryManager interface {
 		op func(fk *PooledKey, lk *PooledKey) error) error
 }
 
-// rdb is the struct used to manage rocksdb backed persistent Log stores.
+// rdb is the struct used to manage kv backed persistent Log stores.
 type rdb struct {
 	cs      *rdbcache
 	keys    *logdbKeyPool
-	kvs     IKvStore
+	kvs     kv.IKVStore
 	entries entryManager
 }
 
-func openRDB(dir string, wal string, batched bool) (*rdb, error) {
-	kvs, err := newKVStore(dir, wal)
+// openRDB creates the on-disk kv store selected by cfg.KVStoreType (falling
+// back to DefaultKVStoreTypeName when it is empty) through the registry
+// populated by RegisterKVStoreFactory, and wraps it in an rdb instance. The
+// selected backend can force the batched entryManager, see
+// RegisterBatchedKVStoreFactory.
+func openRDB(dir string, wal string, batched bool,
+	cfg config.LogDBConfig, fs vfs.IFS) (*rdb, error) {
+	name := cfg.KVStoreType
+	if len(name) == 0 {
+		name = DefaultKVStoreTypeName
+	}
+	reg, ok := getKVStoreFactory(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown kv store type %q", name)
+	}
+	kvs, err := reg.factory(cfg, dir, wal, fs)
 	if err != nil {
 		return nil, err
 	}
 	cs := newRDBCache()
 	pool := newLogdbKeyPool()
 	var em entryManager
-	if batched {
+	if batched || reg.forceBatchedEntries {
 		em = newBatchedEntries(cs, pool, kvs)
 	} else {
 		em = newPlainEntries(cs, pool, kvs)
@@ -103,7 +121,7 @@ func (r *rdb) close() {
 	}
 }
 
-func (r *rdb) getWriteBatch() IWriteBatch {
+func (r *rdb) getWriteBatch() kv.IWriteBatch {
 	return r.kvs.GetWriteBatch(nil)
 }
 
@@ -201,13 +219,13 @@ func (r *rdb) importSnapshot(ss pb.Snapshot, nodeID uint64) error {
 	return r.kvs.CommitWriteBatch(wb)
 }
 
-func (r *rdb) setMaxIndex(wb IWriteBatch,
+func (r *rdb) setMaxIndex(wb kv.IWriteBatch,
 	ud pb.Update, maxIndex uint64, ctx raftio.IContext) {
 	r.cs.setMaxIndex(ud.ClusterID, ud.NodeID, maxIndex)
 	r.recordMaxIndex(wb, ud.ClusterID, ud.NodeID, maxIndex, ctx)
 }
 
-func (r *rdb) recordBootstrap(wb IWriteBatch,
+func (r *rdb) recordBootstrap(wb kv.IWriteBatch,
 	clusterID uint64, nodeID uint64, bsrec pb.Bootstrap) {
 	bskey := newKey(maxKeySize, nil)
 	bskey.setBootstrapKey(clusterID, nodeID)
@@ -218,7 +236,7 @@ func (r *rdb) recordBootstrap(wb IWriteBatch,
 	wb.Put(bskey.Key(), bsdata)
 }
 
-func (r *rdb) recordSnapshot(wb IWriteBatch, ud pb.Update) {
+func (r *rdb) recordSnapshot(wb kv.IWriteBatch, ud pb.Update) {
 	if pb.IsEmptySnapshot(ud.Snapshot) {
 		return
 	}
@@ -231,7 +249,7 @@ func (r *rdb) recordSnapshot(wb IWriteBatch, ud pb.Update) {
 	wb.Put(ko.Key(), data)
 }
 
-func (r *rdb) recordMaxIndex(wb IWriteBatch,
+func (r *rdb) recordMaxIndex(wb kv.IWriteBatch,
 	clusterID uint64, nodeID uint64, index uint64, ctx raftio.IContext) {
 	data := ctx.GetValueBuffer(8)
 	binary.BigEndian.PutUint64(data, index)
@@ -241,7 +259,7 @@ func (r *rdb) recordMaxIndex(wb IWriteBatch,
 	wb.Put(ko.Key(), data)
 }
 
-func (r *rdb) recordStateAllocs(wb IWriteBatch,
+func (r *rdb) recordStateAllocs(wb kv.IWriteBatch,
 	clusterID uint64, nodeID uint64, st pb.State) {
 	data, err := st.Marshal()
 	if err != nil {
@@ -253,7 +271,7 @@ func (r *rdb) recordStateAllocs(wb IWriteBatch,
 }
 
 func (r *rdb) recordState(clusterID uint64,
-	nodeID uint64, st pb.State, wb IWriteBatch, ctx raftio.IContext) {
+	nodeID uint64, st pb.State, wb kv.IWriteBatch, ctx raftio.IContext) {
 	if pb.IsEmptyState(st) {
 		return
 	}
@@ -407,7 +425,7 @@ func (r *rdb) removeNodeData(clusterID uint64, nodeID uint64) error {
 	return r.compaction(clusterID, nodeID, math.MaxUint64)
 }
 
-func (r *rdb) recordRemoveNodeData(wb IWriteBatch,
+func (r *rdb) recordRemoveNodeData(wb kv.IWriteBatch,
 	snapshots []pb.Snapshot, clusterID uint64, nodeID uint64) {
 	stateKey := newKey(maxKeySize, nil)
 	stateKey.SetStateKey(clusterID, nodeID)
@@ -433,7 +451,7 @@ func (r *rdb) compaction(clusterID uint64, nodeID uint64, index uint64) error {
 }
 
 func (r *rdb) saveEntries(updates []pb.Update,
-	wb IWriteBatch, ctx raftio.IContext) {
+	wb kv.IWriteBatch, ctx raftio.IContext) {
 	if len(updates) == 0 {
 		return
 	}